@@ -0,0 +1,135 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/pgzip"
+)
+
+// archiveWriter appends a single named entry at a time to an archive
+// written to dest. Implementations are safe for concurrent use; handleMany
+// itself writes entries one at a time as FetchRange delivers them.
+type archiveWriter interface {
+	WriteFile(name string, r io.Reader) error
+	Close() error
+}
+
+func newArchiveWriter(format string, dest io.WriteCloser) (archiveWriter, error) {
+	switch format {
+	case "zip":
+		return newZipArchiveWriter(dest), nil
+	case "tar":
+		return newTarArchiveWriter(dest, false), nil
+	case "tar.gz":
+		return newTarArchiveWriter(dest, true), nil
+	default:
+		return nil, fmt.Errorf("unsupported --archive format: %s", format)
+	}
+}
+
+// zipArchiveWriter streams each entry straight from r; archive/zip doesn't
+// need the uncompressed size upfront, it falls back to a data descriptor.
+type zipArchiveWriter struct {
+	mu   sync.Mutex
+	dest io.WriteCloser
+	zw   *zip.Writer
+}
+
+func newZipArchiveWriter(dest io.WriteCloser) *zipArchiveWriter {
+	return &zipArchiveWriter{dest: dest, zw: zip.NewWriter(dest)}
+}
+
+func (w *zipArchiveWriter) WriteFile(name string, r io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fw, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	return w.dest.Close()
+}
+
+// tarArchiveWriter buffers each entry to a temp file first, since the tar
+// format requires every entry's size to be declared in its header before
+// the content is written.
+type tarArchiveWriter struct {
+	mu   sync.Mutex
+	dest io.WriteCloser
+	gz   *pgzip.Writer
+	tw   *tar.Writer
+}
+
+func newTarArchiveWriter(dest io.WriteCloser, gzipped bool) *tarArchiveWriter {
+	w := &tarArchiveWriter{dest: dest}
+	tarDest := io.Writer(dest)
+	if gzipped {
+		w.gz = pgzip.NewWriter(dest)
+		tarDest = w.gz
+	}
+	w.tw = tar.NewWriter(tarDest)
+	return w
+}
+
+func (w *tarArchiveWriter) WriteFile(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "chirpsfetch-archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Size: size, Mode: 0644}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, tmp)
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			return err
+		}
+	}
+	return w.dest.Close()
+}
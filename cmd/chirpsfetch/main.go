@@ -0,0 +1,195 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NathanPB/chirpsfetch/pkg/chirps"
+)
+
+var dateFlag = flag.String("date", "", "The date or date range to be fetched (e.g. 2022-01-01 or 2022-01-01..2022-01-31)")
+var pollSizeFlag = flag.Int("poll-size", 128, "The number of records to be fetched and insert at once. Must be greater than 0, only affects date ranges")
+var outputFlag = flag.String("output", "", "Where to write downloaded files: a local path, file://..., or s3://bucket/prefix. If not specified, prints to stdout")
+var attemptsFlag = flag.Int("attemptsFlag", 3, "The number of attempts to be made to fetch the data")
+var noGunzipFlag = flag.Bool("no-gunzip", false, "Do not gunzip the downloaded files")
+var silentFlag = flag.Bool("silent", false, "Do not show the progress bars on stderr. Downloaded data is still written to --output or stdout")
+var precisionFlag = flag.String("precision", "p05", "The precision of the data. Can be either p05 or p25")
+var connectionsFlag = flag.Int("connections", 1, "The number of ranged HTTP connections used to download each file. Falls back to a single stream if the server doesn't support range requests")
+var archiveFlag = flag.String("archive", "", "Stream a date range into a single archive at --output instead of one file per date. Can be zip, tar or tar.gz")
+
+var regexDate = regexp.MustCompile("^\\d{4}-(0[1-9]|1[0-2])-([0-2][1-9]|[1-3]0|3[01])$")
+var regexDateRange = regexp.MustCompile("^\\d{4}-(0[1-9]|1[0-2])-([0-2][1-9]|[1-3]0|3[01])\\.\\.\\d{4}-(0[1-9]|1[0-2])-([0-2][1-9]|[1-3]0|3[01])$")
+
+func main() {
+	flag.Parse()
+
+	if *precisionFlag != "p05" && *precisionFlag != "p25" {
+		panic(fmt.Errorf("invalid precision: %s", *precisionFlag))
+	}
+
+	if *dateFlag == "" {
+		panic("No --date defined")
+	}
+
+	opts := chirps.DefaultOptions()
+	opts.Precision = chirps.Precision(*precisionFlag)
+	opts.Attempts = *attemptsFlag
+	opts.Gunzip = !*noGunzipFlag
+	opts.Concurrency = *pollSizeFlag
+	opts.Connections = *connectionsFlag
+
+	ctx := context.Background()
+	sink, err := chirps.NewOutputSink(ctx, *outputFlag)
+	if err != nil {
+		panic(err)
+	}
+
+	var ui *progressUI
+
+	if regexDate.MatchString(*dateFlag) {
+		if !*silentFlag {
+			ui = newProgressUI(1)
+			opts.Progress = ui.report
+		}
+		client := chirps.NewClient(opts)
+		date, _ := time.Parse(time.DateOnly, *dateFlag)
+		handleOne(client, date, ui, sink)
+	} else if regexDateRange.MatchString(*dateFlag) {
+		if *pollSizeFlag <= 0 {
+			panic("Invalid --poll-size")
+		}
+
+		if *archiveFlag != "" && *outputFlag == "" {
+			panic("--archive requires --output")
+		}
+
+		datesString := strings.Split(*dateFlag, "..")
+		start, _ := time.Parse(time.DateOnly, datesString[0])
+		end, _ := time.Parse(time.DateOnly, datesString[1])
+		if start.After(end) {
+			panic("The start date is after the end date")
+		}
+
+		if !*silentFlag {
+			ui = newProgressUI(int(end.Sub(start).Hours()/24) + 1)
+			opts.Progress = ui.report
+		}
+		client := chirps.NewClient(opts)
+		handleMany(client, start, end, ui, sink)
+	} else {
+		panic("Invalid date format")
+	}
+
+	if ui != nil {
+		ui.wait()
+	}
+}
+
+func handleOne(client *chirps.Client, date time.Time, ui *progressUI, sink chirps.OutputSink) {
+	stream, err := client.Fetch(context.Background(), date)
+	if ui != nil {
+		ui.dateDone(date)
+	}
+	if err != nil {
+		if err.Error() == "response status is not 2xx: 404" {
+			_, err := fmt.Fprintln(os.Stderr, "No data for", date.Format(time.DateOnly))
+			if err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		panic(err)
+	}
+	defer stream.Close()
+
+	writeOut(sink, stream, date, *noGunzipFlag)
+}
+
+func writeOut(sink chirps.OutputSink, stream io.Reader, date time.Time, gzipped bool) {
+	fileName := fmt.Sprintf("%s.tif", date.Format(time.DateOnly))
+	if gzipped {
+		fileName += ".gz"
+	}
+
+	w, err := sink.Writer(fileName)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := io.Copy(w, stream); err != nil {
+		panic(err)
+	}
+
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+}
+
+func handleMany(client *chirps.Client, start, end time.Time, ui *progressUI, sink chirps.OutputSink) {
+	var archive archiveWriter
+	if *archiveFlag != "" {
+		archiveName := fmt.Sprintf("chirps-v2.0.%s-%s.%s", start.Format("2006.01.02"), end.Format("2006.01.02"), *archiveFlag)
+		dest, err := sink.Writer(archiveName)
+		if err != nil {
+			panic(err)
+		}
+		archive, err = newArchiveWriter(*archiveFlag, dest)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	results, err := client.FetchRange(context.Background(), start, end)
+	if err != nil {
+		panic(err)
+	}
+
+	for result := range results {
+		if ui != nil {
+			ui.dateDone(result.Date)
+		}
+
+		if result.Err != nil {
+			if result.Err.Error() == "response status is not 2xx: 404" {
+				fmt.Fprintln(os.Stderr, "No data for", result.Date.Format(time.DateOnly))
+			} else {
+				panic(result.Err)
+			}
+			continue
+		}
+
+		if archive != nil {
+			fileName := fmt.Sprintf("chirps-v2.0.%s.tif", result.Date.Format("2006.01.02"))
+			if err := archive.WriteFile(fileName, result.Reader); err != nil {
+				panic(err)
+			}
+		} else {
+			writeOut(sink, result.Reader, result.Date, *noGunzipFlag)
+		}
+		result.Reader.Close()
+	}
+
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
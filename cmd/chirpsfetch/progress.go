@@ -0,0 +1,93 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// progressUI renders the aggregate "X/Y dates complete" bar plus one
+// transient per-file byte bar per in-flight download. Bars are always
+// written to stderr, so they never interfere with stdout output mode.
+type progressUI struct {
+	container *mpb.Progress
+	aggregate *mpb.Bar
+
+	mu   sync.Mutex
+	bars map[time.Time]*mpb.Bar
+}
+
+func newProgressUI(totalDates int) *progressUI {
+	container := mpb.New(mpb.WithOutput(os.Stderr))
+
+	aggregate := container.New(int64(totalDates),
+		mpb.BarStyle(),
+		mpb.PrependDecorators(
+			decor.Name("dates"),
+			decor.CountersNoUnit("%d / %d"),
+		),
+		mpb.AppendDecorators(
+			decor.Percentage(),
+			decor.AverageETA(decor.ET_STYLE_GO),
+		),
+	)
+
+	return &progressUI{
+		container: container,
+		aggregate: aggregate,
+		bars:      make(map[time.Time]*mpb.Bar),
+	}
+}
+
+// report is wired up as chirps.Options.Progress, so it's called from
+// whichever goroutine is downloading date's file.
+func (ui *progressUI) report(date time.Time, downloaded, total int64) {
+	ui.mu.Lock()
+	bar, ok := ui.bars[date]
+	if !ok {
+		bar = ui.container.New(total,
+			mpb.BarStyle(),
+			mpb.BarRemoveOnComplete(),
+			mpb.PrependDecorators(decor.Name(date.Format(time.DateOnly))),
+			mpb.AppendDecorators(decor.CountersKibiByte("% .1f / % .1f")),
+		)
+		ui.bars[date] = bar
+	}
+	ui.mu.Unlock()
+
+	bar.SetCurrent(downloaded)
+}
+
+// dateDone marks date's per-file bar finished (aborting it if it never
+// reached its total, e.g. a 404 or a failed download) and advances the
+// aggregate bar.
+func (ui *progressUI) dateDone(date time.Time) {
+	ui.mu.Lock()
+	bar, ok := ui.bars[date]
+	delete(ui.bars, date)
+	ui.mu.Unlock()
+
+	if ok && !bar.Completed() {
+		bar.Abort(true)
+	}
+
+	ui.aggregate.Increment()
+}
+
+func (ui *progressUI) wait() {
+	ui.container.Wait()
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+// Package chirps provides a reusable client for fetching CHIRPS-2.0 daily
+// precipitation rasters from UCSB/CHC, so that consumers other than the
+// chirpsfetch CLI can embed the download logic into their own pipelines.
+package chirps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Precision selects which CHIRPS-2.0 grid resolution to fetch.
+type Precision string
+
+const (
+	PrecisionP05 Precision = "p05"
+	PrecisionP25 Precision = "p25"
+)
+
+// URLBuilder builds the download URL for a given precision and date. Callers
+// can override this on Options to point at a mirror or a different layout.
+type URLBuilder func(precision Precision, date time.Time) string
+
+// DefaultURLBuilder builds URLs against the canonical UCSB/CHC tree.
+func DefaultURLBuilder(precision Precision, date time.Time) string {
+	return fmt.Sprintf(
+		"https://data.chc.ucsb.edu/products/CHIRPS-2.0/global_daily/tifs/%s/%04d/chirps-v2.0.%04d.%02d.%02d.tif.gz",
+		precision,
+		date.Year(),
+		date.Year(),
+		date.Month(),
+		date.Day(),
+	)
+}
+
+// Options configures a Client.
+type Options struct {
+	// Precision selects the grid resolution. Defaults to PrecisionP05.
+	Precision Precision
+
+	// Concurrency is the number of dates fetched at once by FetchRange.
+	// Defaults to 128.
+	Concurrency int
+
+	// Attempts is the total number of times a single file download is
+	// tried before giving up. Defaults to 3.
+	Attempts int
+
+	// Gunzip decompresses the downloaded .tif.gz before handing it back.
+	// Defaults to true.
+	Gunzip bool
+
+	// HTTPClient is used to perform requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// URLBuilder builds the download URL for a date. Defaults to
+	// DefaultURLBuilder.
+	URLBuilder URLBuilder
+
+	// Connections is the number of byte ranges each file is split into and
+	// fetched concurrently. Values <= 1 use a single stream. Requires the
+	// server to advertise Accept-Ranges: bytes; falls back to a single
+	// stream otherwise.
+	Connections int
+
+	// TempDir is where in-progress ranged downloads (and their .part
+	// resume sidecars) are kept. Defaults to os.TempDir().
+	TempDir string
+
+	// Progress, if set, is called with the number of bytes downloaded so
+	// far for date out of total (the compressed Content-Length) every time
+	// a chunk of the response body is read. total is 0 when the server
+	// didn't report a Content-Length. Callers wanting a progress UI (e.g.
+	// mpb bars) can wire this up; it is never called concurrently for the
+	// same date.
+	Progress ProgressFunc
+
+	// Decompressor decodes the downloaded .tif.gz when Gunzip is true.
+	// Defaults to PgzipDecompressor.
+	Decompressor Decompressor
+}
+
+// ProgressFunc reports download progress for a single date.
+type ProgressFunc func(date time.Time, downloaded, total int64)
+
+func (o Options) tempDir() string {
+	if o.TempDir != "" {
+		return o.TempDir
+	}
+	return os.TempDir()
+}
+
+// DefaultOptions returns the Options a bare Client is constructed with.
+func DefaultOptions() Options {
+	return Options{
+		Precision:    PrecisionP05,
+		Concurrency:  128,
+		Attempts:     3,
+		Gunzip:       true,
+		HTTPClient:   http.DefaultClient,
+		URLBuilder:   DefaultURLBuilder,
+		Decompressor: PgzipDecompressor,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	if o.Precision == "" {
+		o.Precision = PrecisionP05
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 128
+	}
+	if o.Attempts <= 0 {
+		o.Attempts = 3
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = http.DefaultClient
+	}
+	if o.URLBuilder == nil {
+		o.URLBuilder = DefaultURLBuilder
+	}
+	if o.Decompressor == nil {
+		o.Decompressor = PgzipDecompressor
+	}
+	return o
+}
+
+// Client fetches CHIRPS-2.0 rasters according to its Options.
+type Client struct {
+	opts Options
+}
+
+// NewClient builds a Client, filling in zero-valued fields of opts with
+// their defaults.
+func NewClient(opts Options) *Client {
+	return &Client{opts: opts.withDefaults()}
+}
+
+type closingReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *closingReader) Close() error {
+	return r.closer.Close()
+}
+
+// multiCloser closes every closer in order, stopping at (and returning) the
+// first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	for _, c := range m {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// progressReader reports bytes read through fn as the wrapped reader is
+// consumed.
+type progressReader struct {
+	r          io.Reader
+	date       time.Time
+	total      int64
+	downloaded int64
+	fn         ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.downloaded += int64(n)
+	p.fn(p.date, p.downloaded, p.total)
+	return n, err
+}
+
+// Fetch downloads, and (unless Options.Gunzip is false) decompresses, the
+// raster for a single date. Callers must Close the returned ReadCloser.
+func (c *Client) Fetch(ctx context.Context, date time.Time) (io.ReadCloser, error) {
+	url := c.opts.URLBuilder(c.opts.Precision, date)
+	if c.opts.Connections > 1 {
+		return c.rangedFetch(ctx, date, url)
+	}
+	return c.downloadAndUnzipIfNeeded(ctx, date, url)
+}
+
+// Result is delivered on the channel returned by FetchRange, one per date.
+type Result struct {
+	Date   time.Time
+	Reader io.ReadCloser
+	Err    error
+}
+
+// FetchRange fetches every date between start and end (inclusive) using up
+// to Options.Concurrency workers, delivering one Result per date on the
+// returned channel. The channel is closed once every date has been
+// delivered.
+func (c *Client) FetchRange(ctx context.Context, start, end time.Time) (<-chan Result, error) {
+	if start.After(end) {
+		return nil, fmt.Errorf("the start date is after the end date")
+	}
+
+	dates := append(make([]time.Time, 0), start)
+	for {
+		current := dates[len(dates)-1]
+		if current.Equal(end) || current.After(end) {
+			break
+		}
+		dates = append(dates, current.AddDate(0, 0, 1))
+	}
+
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		workPool := make(chan struct{}, c.opts.Concurrency)
+		var wg sync.WaitGroup
+
+		for _, date := range dates {
+			workPool <- struct{}{}
+			wg.Add(1)
+
+			date := date
+			go func() {
+				defer func() {
+					<-workPool
+					wg.Done()
+				}()
+				reader, err := c.Fetch(ctx, date)
+				results <- Result{Date: date, Reader: reader, Err: err}
+			}()
+		}
+
+		wg.Wait()
+	}()
+
+	return results, nil
+}
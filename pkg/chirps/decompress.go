@@ -0,0 +1,46 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/pgzip"
+)
+
+// Decompressor builds a gzip-decoding reader over r. It exists so the
+// (often 50-100 MB) CHIRPS TIFs can be decoded with a parallel gzip
+// implementation instead of being limited to a single core.
+type Decompressor interface {
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type gzipDecompressor struct{}
+
+func (gzipDecompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type pgzipDecompressor struct{}
+
+func (pgzipDecompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return pgzip.NewReader(r)
+}
+
+// GzipDecompressor decodes using the standard library's compress/gzip,
+// single-threaded.
+var GzipDecompressor Decompressor = gzipDecompressor{}
+
+// PgzipDecompressor decodes using github.com/klauspost/pgzip, spreading
+// decompression work across multiple cores. This is the default.
+var PgzipDecompressor Decompressor = pgzipDecompressor{}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// permanentError marks a failure that more attempts won't fix (e.g. a 404),
+// so downloadAndUnzipIfNeeded should stop retrying immediately.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func isPermanentStatus(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusUnauthorized
+}
+
+// backoff returns the exponential delay (base * 2^attempt, plus jitter)
+// before retrying the given zero-indexed attempt.
+func backoff(attempt int) time.Duration {
+	base := 500 * time.Millisecond
+	d := base * time.Duration(int64(1)<<uint(attempt))
+	return d + time.Duration(rand.Int63n(int64(base)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// downloadAndUnzipIfNeeded downloads url to a temp file, verifying it
+// against the CHC-published .md5 sidecar when one is published. Transient
+// failures (5xx, connection resets, a body shorter than Content-Length, an
+// md5 mismatch) are retried with exponential backoff and jitter; permanent
+// failures (404, 401) are returned immediately.
+func (c *Client) downloadAndUnzipIfNeeded(ctx context.Context, date time.Time, url string) (io.ReadCloser, error) {
+	var errs []error
+
+	for attempt := 0; attempt < c.opts.Attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(attempt-1)); err != nil {
+				return nil, err
+			}
+		}
+
+		path, err := c.downloadOnce(ctx, date, url)
+		if err != nil {
+			var perm *permanentError
+			if errors.As(err, &perm) {
+				return nil, perm.err
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		return c.openDownloaded(path)
+	}
+
+	return nil, fmt.Errorf("too many attempts, last errors: %w", errors.Join(errs...))
+}
+
+// downloadOnce performs a single download attempt, returning the path to
+// the resulting temp file.
+func (c *Client) downloadOnce(ctx context.Context, date time.Time, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("response status is not 2xx: %d", resp.StatusCode)
+		if isPermanentStatus(resp.StatusCode) {
+			return "", &permanentError{err}
+		}
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(c.opts.tempDir(), "chirpsfetch-*.tif.gz")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	var body io.Reader = resp.Body
+	if c.opts.Progress != nil {
+		// net/http reports an unknown Content-Length as -1.
+		total := resp.ContentLength
+		if total < 0 {
+			total = 0
+		}
+		body = &progressReader{r: resp.Body, date: date, total: total, fn: c.opts.Progress}
+	}
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("reading response body: %w", err)
+	}
+
+	if expected, ok := c.fetchExpectedMD5(ctx, url); ok {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+			os.Remove(tmp.Name())
+			return "", fmt.Errorf("md5 mismatch for %s: expected %s, got %s", url, expected, actual)
+		}
+	}
+
+	return tmp.Name(), nil
+}
+
+// fetchExpectedMD5 fetches url's CHC-published .md5 sidecar. ok is false
+// when the sidecar couldn't be retrieved, in which case the caller should
+// skip verification rather than fail the download.
+func (c *Client) fetchExpectedMD5(ctx context.Context, url string) (digest string, ok bool) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url+".md5", nil)
+	if err != nil {
+		return "", false
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", false
+	}
+
+	return parseMD5Sidecar(body)
+}
+
+// parseMD5Sidecar extracts the hex digest from a CHC .md5 sidecar body,
+// which is a single line of the form "<digest>  <filename>".
+func parseMD5Sidecar(body []byte) (digest string, ok bool) {
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	return strings.ToLower(fields[0]), true
+}
+
+// verifyFileMD5 hashes the file at path and returns an error if it doesn't
+// match expected.
+func verifyFileMD5(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("md5 mismatch for %s: expected %s, got %s", path, expected, actual)
+	}
+
+	return nil
+}
+
+// closerFunc lets an arbitrary func satisfy io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// openDownloaded opens the temp file written by downloadOnce, decompressing
+// it if requested, and removes it from disk once the returned ReadCloser is
+// closed.
+func (c *Client) openDownloaded(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.opts.Gunzip {
+		return &closingReader{file, closerFunc(func() error {
+			err := file.Close()
+			os.Remove(path)
+			return err
+		})}, nil
+	}
+
+	reader, err := c.opts.Decompressor.NewReader(file)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &closingReader{reader, closerFunc(func() error {
+		err := multiCloser{reader, file}.Close()
+		os.Remove(path)
+		return err
+	})}, nil
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsPermanentStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusOK, false},
+		{http.StatusForbidden, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+		{http.StatusTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		if got := isPermanentStatus(tt.code); got != tt.want {
+			t.Errorf("isPermanentStatus(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base := 500 * time.Millisecond
+
+	for attempt := 0; attempt < 5; attempt++ {
+		min := base * time.Duration(int64(1)<<uint(attempt))
+		max := min + base
+
+		d := backoff(attempt)
+		if d < min || d >= max {
+			t.Errorf("backoff(%d) = %v, want in [%v, %v)", attempt, d, min, max)
+		}
+	}
+}
+
+func TestParseMD5Sidecar(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		digest string
+		ok     bool
+	}{
+		{
+			name:   "digest and filename",
+			body:   "d41d8cd98f00b204e9800998ecf8427e  chirps-v2.0.2023.01.01.tif.gz\n",
+			digest: "d41d8cd98f00b204e9800998ecf8427e",
+			ok:     true,
+		},
+		{
+			name:   "uppercase digest is lowercased",
+			body:   "D41D8CD98F00B204E9800998ECF8427E  chirps-v2.0.2023.01.01.tif.gz",
+			digest: "d41d8cd98f00b204e9800998ecf8427e",
+			ok:     true,
+		},
+		{
+			name: "empty body",
+			body: "",
+			ok:   false,
+		},
+		{
+			name: "whitespace only",
+			body: "   \n",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, ok := parseMD5Sidecar([]byte(tt.body))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if digest != tt.digest {
+				t.Fatalf("digest = %q, want %q", digest, tt.digest)
+			}
+		})
+	}
+}
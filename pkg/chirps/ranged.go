@@ -0,0 +1,306 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chunk tracks the byte range [Offset, Offset+Length) of a ranged download
+// and whether it has been fetched yet. Chunks are persisted to the .part
+// sidecar so an interrupted download only re-fetches unfinished ranges.
+type chunk struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	Done   bool  `json:"done"`
+}
+
+// partMeta is the JSON contents of a .part sidecar file.
+type partMeta struct {
+	URL    string  `json:"url"`
+	Size   int64   `json:"size"`
+	Chunks []chunk `json:"chunks"`
+}
+
+func loadPartMeta(partPath string) (*partMeta, error) {
+	f, err := os.Open(partPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var meta partMeta
+	if err := json.NewDecoder(f).Decode(&meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (m *partMeta) save(partPath string) error {
+	f, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(m)
+}
+
+// rangedDownloadPath returns the path rangedFetch assembles url's chunks
+// into. It's keyed off a hash of the full URL, not just its basename, since
+// different precisions/mirrors can share the same filename (e.g. p05 and
+// p25 both produce chirps-v2.0.YYYY.MM.DD.tif.gz) and would otherwise race
+// on the same download/.part files.
+func rangedDownloadPath(tempDir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(tempDir, fmt.Sprintf("%x-%s", sum[:8], path.Base(url)))
+}
+
+// supportsRangedDownload issues a HEAD request to learn the file size and
+// whether the server honors Range requests. It returns ok=false whenever
+// either is unavailable, signaling the caller to fall back to a single
+// stream.
+func (c *Client) supportsRangedDownload(ctx context.Context, url string) (size int64, ok bool) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, false
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, false
+	}
+
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return 0, false
+	}
+
+	if resp.ContentLength <= 0 {
+		return 0, false
+	}
+
+	return resp.ContentLength, true
+}
+
+// rangedFetch splits url into Options.Connections byte ranges, downloads
+// them concurrently and reassembles them into a single file under
+// Options.TempDir, resuming from a .part sidecar if one exists, then
+// verifies the reassembled file against the CHC-published .md5 sidecar the
+// same way downloadAndUnzipIfNeeded does. It falls back to
+// downloadAndUnzipIfNeeded when the server doesn't support ranged requests.
+func (c *Client) rangedFetch(ctx context.Context, date time.Time, url string) (io.ReadCloser, error) {
+	size, ok := c.supportsRangedDownload(ctx, url)
+	if !ok {
+		return c.downloadAndUnzipIfNeeded(ctx, date, url)
+	}
+
+	downloadPath := rangedDownloadPath(c.opts.tempDir(), url)
+	partPath := downloadPath + ".part"
+
+	meta, err := loadPartMeta(partPath)
+	if err != nil || meta.URL != url || meta.Size != size {
+		meta = newPartMeta(url, size, c.opts.Connections)
+	}
+
+	file, err := os.OpenFile(downloadPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := make([]error, 0)
+
+	var downloaded atomic.Int64
+	for _, ch := range meta.Chunks {
+		if ch.Done {
+			downloaded.Add(ch.Length)
+		}
+	}
+
+	for i := range meta.Chunks {
+		ch := &meta.Chunks[i]
+		if ch.Done {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ch *chunk) {
+			defer wg.Done()
+
+			if err := c.fetchChunkWithRetry(ctx, url, file, ch, &downloaded); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			ch.Done = true
+			_ = meta.save(partPath)
+			if c.opts.Progress != nil {
+				c.opts.Progress(date, downloaded.Load(), size)
+			}
+			mu.Unlock()
+		}(ch)
+	}
+	wg.Wait()
+
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if expected, ok := c.fetchExpectedMD5(ctx, url); ok {
+		if err := verifyFileMD5(downloadPath, expected); err != nil {
+			os.Remove(downloadPath)
+			_ = os.Remove(partPath)
+			return nil, err
+		}
+	}
+
+	_ = os.Remove(partPath)
+
+	final, err := os.Open(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.opts.Gunzip {
+		return &closingReader{final, closerFunc(func() error {
+			err := final.Close()
+			os.Remove(downloadPath)
+			return err
+		})}, nil
+	}
+
+	reader, err := c.opts.Decompressor.NewReader(final)
+	if err != nil {
+		final.Close()
+		os.Remove(downloadPath)
+		return nil, err
+	}
+	return &closingReader{reader, closerFunc(func() error {
+		err := multiCloser{reader, final}.Close()
+		os.Remove(downloadPath)
+		return err
+	})}, nil
+}
+
+// fetchChunkWithRetry fetches ch with the same attempt/backoff policy as
+// downloadAndUnzipIfNeeded, returning immediately on a permanent error (404,
+// 401) and only giving up on a transient one after Options.Attempts tries.
+func (c *Client) fetchChunkWithRetry(ctx context.Context, url string, file *os.File, ch *chunk, downloaded *atomic.Int64) error {
+	var errs []error
+
+	for attempt := 0; attempt < c.opts.Attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(attempt-1)); err != nil {
+				return err
+			}
+		}
+
+		err := c.fetchChunk(ctx, url, file, ch, downloaded)
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		errs = append(errs, err)
+	}
+
+	return fmt.Errorf("too many attempts, last errors: %w", errors.Join(errs...))
+}
+
+func (c *Client) fetchChunk(ctx context.Context, url string, file *os.File, ch *chunk, downloaded *atomic.Int64) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", ch.Offset, ch.Offset+ch.Length-1))
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		if isPermanentStatus(resp.StatusCode) {
+			return &permanentError{fmt.Errorf("response status is not 2xx: %d", resp.StatusCode)}
+		}
+		return fmt.Errorf("response status is not 206: %d", resp.StatusCode)
+	}
+
+	if _, err := io.Copy(io.NewOffsetWriter(file, ch.Offset), resp.Body); err != nil {
+		return err
+	}
+
+	downloaded.Add(ch.Length)
+	return nil
+}
+
+func newPartMeta(url string, size int64, connections int) *partMeta {
+	if connections <= 0 {
+		connections = 1
+	}
+	// Never split into more chunks than there are bytes: a sub-1-byte chunk
+	// would produce a negative Range header that the server will reject.
+	if int64(connections) > size {
+		connections = int(size)
+	}
+	if connections <= 0 {
+		connections = 1
+	}
+
+	chunkSize := size / int64(connections)
+	chunks := make([]chunk, 0, connections)
+
+	offset := int64(0)
+	for i := 0; i < connections; i++ {
+		length := chunkSize
+		if i == connections-1 {
+			length = size - offset
+		}
+		chunks = append(chunks, chunk{Offset: offset, Length: length})
+		offset += length
+	}
+
+	return &partMeta{URL: url, Size: size, Chunks: chunks}
+}
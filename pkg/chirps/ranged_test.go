@@ -0,0 +1,70 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import "testing"
+
+func TestNewPartMeta(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int64
+		connections int
+		wantChunks  int
+	}{
+		{"even split", 100, 4, 4},
+		{"uneven split gives the remainder to the last chunk", 101, 4, 4},
+		{"zero connections defaults to one chunk", 100, 0, 1},
+		{"negative connections defaults to one chunk", 100, -3, 1},
+		{"more connections than bytes clamps to one chunk per byte", 3, 10, 3},
+		{"single byte clamps to a single chunk", 1, 10, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := newPartMeta("https://example.com/f.tif.gz", tt.size, tt.connections)
+
+			if len(meta.Chunks) != tt.wantChunks {
+				t.Fatalf("got %d chunks, want %d", len(meta.Chunks), tt.wantChunks)
+			}
+
+			var total int64
+			offset := int64(0)
+			for i, ch := range meta.Chunks {
+				if ch.Length <= 0 {
+					t.Fatalf("chunk %d has non-positive length %d", i, ch.Length)
+				}
+				if ch.Offset != offset {
+					t.Fatalf("chunk %d offset = %d, want %d", i, ch.Offset, offset)
+				}
+				total += ch.Length
+				offset += ch.Length
+			}
+
+			if total != tt.size {
+				t.Fatalf("chunks cover %d bytes, want %d", total, tt.size)
+			}
+		})
+	}
+}
+
+func TestRangedDownloadPath(t *testing.T) {
+	p05 := rangedDownloadPath("/tmp", "https://data.chc.ucsb.edu/products/CHIRPS-2.0/global_daily/tifs/p05/2023/chirps-v2.0.2023.01.01.tif.gz")
+	p25 := rangedDownloadPath("/tmp", "https://data.chc.ucsb.edu/products/CHIRPS-2.0/global_daily/tifs/p25/2023/chirps-v2.0.2023.01.01.tif.gz")
+
+	if p05 == p25 {
+		t.Fatalf("rangedDownloadPath collided for two precisions sharing a basename: %s", p05)
+	}
+
+	if got := rangedDownloadPath("/tmp", "https://example.com/f.tif.gz"); got != rangedDownloadPath("/tmp", "https://example.com/f.tif.gz") {
+		t.Fatalf("rangedDownloadPath is not deterministic: %s != %s", got, rangedDownloadPath("/tmp", "https://example.com/f.tif.gz"))
+	}
+}
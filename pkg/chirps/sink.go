@@ -0,0 +1,136 @@
+/*
+ * Copyright 2023 Nathan P. Bombana
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ *
+ */
+
+package chirps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// OutputSink is a pluggable destination for downloaded rasters, so library
+// consumers can stream files straight into object storage instead of
+// staging them on local disk first.
+type OutputSink interface {
+	// Writer opens name (e.g. "2022-01-01.tif") for writing. Callers must
+	// Close the returned writer.
+	Writer(name string) (io.WriteCloser, error)
+}
+
+// LocalSink writes files into Dir on the local filesystem, creating it if
+// it doesn't exist yet. This is the historical --save <dir> behavior.
+type LocalSink struct {
+	Dir string
+}
+
+func (s LocalSink) Writer(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(s.Dir, name))
+}
+
+// StdoutSink ignores name and writes everything to os.Stdout. Only
+// meaningful when a single file is being fetched.
+type StdoutSink struct{}
+
+type nopCloseWriter struct{ io.Writer }
+
+func (nopCloseWriter) Close() error { return nil }
+
+func (StdoutSink) Writer(string) (io.WriteCloser, error) {
+	return nopCloseWriter{os.Stdout}, nil
+}
+
+// S3Sink uploads files to Bucket under Prefix via the S3 multipart upload
+// API, so a full TIF is never buffered in memory.
+type S3Sink struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+func (s S3Sink) Writer(name string) (io.WriteCloser, error) {
+	key := strings.TrimPrefix(path.Join(s.Prefix, name), "/")
+
+	pr, pw := io.Pipe()
+	uploader := manager.NewUploader(s.Client)
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := uploader.Upload(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String(s.Bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &s3Writer{pw: pw, done: done}, nil
+}
+
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+// NewOutputSink builds an OutputSink from a URI: a bare local path,
+// file://..., s3://bucket/prefix, or "" / "-" for stdout.
+func NewOutputSink(ctx context.Context, uri string) (OutputSink, error) {
+	if uri == "" || uri == "-" {
+		return StdoutSink{}, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return LocalSink{Dir: uri}, nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return LocalSink{Dir: u.Path}, nil
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return S3Sink{
+			Client: s3.NewFromConfig(cfg),
+			Bucket: u.Host,
+			Prefix: strings.TrimPrefix(u.Path, "/"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --output scheme: %s://", u.Scheme)
+	}
+}